@@ -0,0 +1,144 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+
+	secrand "github.com/google/differential-privacy/go/rand"
+)
+
+// discreteGaussian implements the Noise interface using noise sampled from
+// the discrete Gaussian distribution on Z: the distribution with PMF
+// proportional to exp(-x²/(2σ²)) for integer x.
+type discreteGaussian struct{}
+
+// DiscreteGaussian returns a Noise instance that adds discrete Gaussian
+// noise to its inputs.
+func DiscreteGaussian() Noise {
+	return discreteGaussian{}
+}
+
+// AddNoiseInt64 adds discrete Gaussian noise to x, calibrated so that the
+// result is (epsilon, delta)-differentially private for a query with the
+// given l0Sensitivity and lInfSensitivity.
+func (discreteGaussian) AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error) {
+	sigma, err := discreteGaussianSigma(l0Sensitivity, lInfSensitivity, epsilon, delta)
+	if err != nil {
+		return 0, err
+	}
+	return x + sampleDiscreteGaussian(sigma), nil
+}
+
+// AddNoiseFloat64 adds discrete Gaussian noise to x, rounding the sensitivity
+// bound up to the nearest integer first, since the discrete Gaussian is only
+// defined on Z. Prefer AddNoiseInt64 for integer-valued queries, which don't
+// need this rounding.
+func (discreteGaussian) AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error) {
+	sigma, err := discreteGaussianSigma(l0Sensitivity, int64(math.Ceil(lInfSensitivity)), epsilon, delta)
+	if err != nil {
+		return 0, err
+	}
+	return x + float64(sampleDiscreteGaussian(sigma)), nil
+}
+
+// Threshold returns the smallest partition count that survives partition
+// selection: a privacy identifier contributes to at most l0Sensitivity
+// partitions, each by at most lInfSensitivity, so by a union bound over
+// those partitions, releasing only partitions whose noised count exceeds
+//
+//	lInfSensitivity + sigma*sqrt(2*ln(l0Sensitivity/thresholdDelta))
+//
+// where sigma is the discrete Gaussian mechanism's standard deviation for
+// (epsilon, noiseDelta), keeps the probability that a partition present
+// solely because of noise survives to at most thresholdDelta.
+func (discreteGaussian) Threshold(l0Sensitivity int64, lInfSensitivity, epsilon, noiseDelta, thresholdDelta float64) (float64, error) {
+	sigma, err := discreteGaussianSigma(l0Sensitivity, int64(math.Ceil(lInfSensitivity)), epsilon, noiseDelta)
+	if err != nil {
+		return 0, err
+	}
+	return lInfSensitivity + sigma*math.Sqrt(2*math.Log(float64(l0Sensitivity)/thresholdDelta)), nil
+}
+
+// discreteGaussianSigma picks σ for the discrete Gaussian mechanism by
+// reusing the analytic (continuous) Gaussian mechanism's (ε,δ)→σ
+// calibration: the l2 sensitivity of a query touching at most
+// l0Sensitivity partitions, each bounded by lInfSensitivity, is
+// sqrt(l0Sensitivity)·lInfSensitivity, and the analytic Gaussian
+// mechanism's σ for that l2 sensitivity is also a valid (slightly
+// conservative) σ for the discrete mechanism; see Canonne, Kamath & Steinke,
+// "The Discrete Gaussian for Differential Privacy" (2020), Corollary 19.
+func discreteGaussianSigma(l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (float64, error) {
+	l2Sensitivity := math.Sqrt(float64(l0Sensitivity)) * float64(lInfSensitivity)
+	return analyticGaussianSigma(l2Sensitivity, epsilon, delta)
+}
+
+// sampleDiscreteGaussian draws one sample from the discrete Gaussian
+// distribution on Z with standard deviation sigma, by rejection sampling
+// against a discrete Laplace proposal: sample T ~ DLap(1/⌈sigma⌉), and
+// accept it with probability exp(-(|T|-sigma²/⌈sigma⌉)²/(2·sigma²)). All
+// randomness is drawn from secrand, the same crypto/rand-backed source the
+// package's other noise mechanisms use, since a predictable PRNG would void
+// the (epsilon, delta) guarantee.
+func sampleDiscreteGaussian(sigma float64) int64 {
+	t := int64(math.Ceil(sigma))
+	if t < 1 {
+		t = 1
+	}
+	for {
+		x := sampleDiscreteLaplace(t)
+		bias := math.Abs(float64(x)) - sigma*sigma/float64(t)
+		acceptProbability := math.Exp(-(bias * bias) / (2 * sigma * sigma))
+		if secureFloat64() <= acceptProbability {
+			return x
+		}
+	}
+}
+
+// sampleDiscreteLaplace draws one sample from the discrete Laplace
+// (two-sided geometric) distribution on Z with scale t, i.e. the
+// distribution with PMF proportional to exp(-|x|/t).
+func sampleDiscreteLaplace(t int64) int64 {
+	p := 1 - math.Exp(-1/float64(t))
+	for {
+		magnitude := int64(math.Floor(math.Log(1-secureFloat64()) / math.Log(1-p)))
+		sign := int64(1)
+		if secureBool() {
+			sign = -1
+		}
+		x := sign * magnitude
+		// Avoid double-counting x=0, which has no sign.
+		if x != 0 || secureBool() {
+			return x
+		}
+	}
+}
+
+// secureFloat64 returns a cryptographically secure pseudo-random float64 in
+// [0, 1), built from secrand.Uint64 the same way math/rand's own Float64
+// is built from a 64-bit source: keep the top 53 bits, which is all a
+// float64's mantissa can hold.
+func secureFloat64() float64 {
+	return float64(secrand.Uint64()>>11) / (1 << 53)
+}
+
+// secureBool returns a cryptographically secure pseudo-random boolean, used
+// in place of rand.Float64() < 0.5 for coin flips that don't need a full
+// float's worth of randomness.
+func secureBool() bool {
+	return secrand.Uint64()&1 == 0
+}
@@ -0,0 +1,72 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	"math"
+	"testing"
+)
+
+// TestSampleDiscreteGaussianDistribution checks that sampleDiscreteGaussian's
+// empirical mean and variance over many draws are close to the distribution
+// it's supposed to implement (mean 0, variance ≈ sigma²), and that it's
+// symmetric around 0.
+func TestSampleDiscreteGaussianDistribution(t *testing.T) {
+	const (
+		sigma       = 10.0
+		numSamples  = 100000
+		meanTol     = 0.5
+		varianceTol = 0.1 // relative
+	)
+	var sum, sumSquares float64
+	for i := 0; i < numSamples; i++ {
+		x := float64(sampleDiscreteGaussian(sigma))
+		sum += x
+		sumSquares += x * x
+	}
+	mean := sum / numSamples
+	variance := sumSquares/numSamples - mean*mean
+
+	if math.Abs(mean) > meanTol {
+		t.Errorf("sampleDiscreteGaussian(%f) mean = %f, want close to 0 (tolerance %f)", sigma, mean, meanTol)
+	}
+	wantVariance := sigma * sigma
+	if math.Abs(variance-wantVariance)/wantVariance > varianceTol {
+		t.Errorf("sampleDiscreteGaussian(%f) variance = %f, want close to %f (relative tolerance %f)", sigma, variance, wantVariance, varianceTol)
+	}
+}
+
+// TestSampleDiscreteGaussianSmallSigma checks that, even for a sigma smaller
+// than 1 (where the discrete Laplace proposal's scale t is clamped to 1),
+// sampleDiscreteGaussian terminates and returns a small-magnitude sample.
+func TestSampleDiscreteGaussianSmallSigma(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		x := sampleDiscreteGaussian(0.5)
+		if x < -10 || x > 10 {
+			t.Errorf("sampleDiscreteGaussian(0.5) = %d, want a value within [-10, 10]", x)
+		}
+	}
+}
+
+// TestAddNoiseInt64Errors checks that AddNoiseInt64 forwards the error from
+// an invalid (epsilon, delta) rather than silently returning an unnoised
+// value.
+func TestAddNoiseInt64Errors(t *testing.T) {
+	if _, err := DiscreteGaussian().AddNoiseInt64(0, 1, 1, -1, 0.01); err == nil {
+		t.Error("AddNoiseInt64 with a negative epsilon: got no error, want one")
+	}
+}
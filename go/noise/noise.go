@@ -0,0 +1,74 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package noise
+
+import (
+	log "github.com/golang/glog"
+)
+
+// Kind identifies a differential privacy noise mechanism.
+type Kind int
+
+const (
+	// Unrecognised is Kind's zero value. Passing it to ToNoise is an error;
+	// aggregations use it to detect an unset NoiseKind.
+	Unrecognised Kind = iota
+	// LaplaceNoise identifies the Laplace mechanism.
+	LaplaceNoise
+	// GaussianNoise identifies the (continuous) Gaussian mechanism.
+	GaussianNoise
+	// DiscreteGaussianNoise identifies the discrete Gaussian mechanism: noise
+	// is sampled on the integers rather than on the reals the way
+	// GaussianNoise's is, so integer-valued aggregations such as Count don't
+	// need a float rounding step to use it.
+	DiscreteGaussianNoise
+)
+
+// Noise is the interface implemented by the differential privacy noise
+// mechanisms in this package.
+type Noise interface {
+	// AddNoiseInt64 adds noise to x so that the result is
+	// (epsilon, delta)-differentially private for a query with the given
+	// l0Sensitivity and lInfSensitivity.
+	AddNoiseInt64(x, l0Sensitivity, lInfSensitivity int64, epsilon, delta float64) (int64, error)
+	// AddNoiseFloat64 adds noise to x so that the result is
+	// (epsilon, delta)-differentially private for a query with the given
+	// l0Sensitivity and lInfSensitivity.
+	AddNoiseFloat64(x float64, l0Sensitivity int64, lInfSensitivity, epsilon, delta float64) (float64, error)
+	// Threshold returns the smallest partition count that survives partition
+	// selection at the given epsilon, with noiseDelta spent noising each
+	// partition and thresholdDelta spent on the selection step itself, for a
+	// privacy identifier contributing to at most l0Sensitivity partitions
+	// with at most lInfSensitivity per partition. Only partitions whose
+	// noised count exceeds the threshold should be released.
+	Threshold(l0Sensitivity int64, lInfSensitivity, epsilon, noiseDelta, thresholdDelta float64) (float64, error)
+}
+
+// ToNoise returns the Noise implementation identified by kind.
+func ToNoise(kind Kind) Noise {
+	switch kind {
+	case LaplaceNoise:
+		return Laplace()
+	case GaussianNoise:
+		return Gaussian()
+	case DiscreteGaussianNoise:
+		return DiscreteGaussian()
+	default:
+		log.Exitf("noise.ToNoise: unknown noise.Kind %v", kind)
+		return nil
+	}
+}
@@ -17,19 +17,30 @@
 package pbeam
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"reflect"
+	"sort"
 
 	log "github.com/golang/glog"
 	"github.com/google/differential-privacy/go/checks"
 	"github.com/google/differential-privacy/go/noise"
 	"github.com/google/differential-privacy/privacy-on-beam/internal/kv"
 	"github.com/apache/beam/sdks/go/pkg/beam"
+	"github.com/apache/beam/sdks/go/pkg/beam/core/graph/window"
 	"github.com/apache/beam/sdks/go/pkg/beam/transforms/stats"
 )
 
 // CountParams specifies the parameters associated with a Count aggregation.
 type CountParams struct {
-	// Noise type (which is either LaplaceNoise{} or GaussianNoise{}).
+	// Noise type (which is one of LaplaceNoise{}, GaussianNoise{}, or
+	// DiscreteGaussianNoise{}).
+	//
+	// DiscreteGaussianNoise{} samples noise on the integers rather than on
+	// the reals, so it is rounding-free and should be preferred over
+	// GaussianNoise{} whenever the (epsilon, delta) calibration allows it,
+	// since Count's output is itself an integer.
 	//
 	// Defaults to LaplaceNoise{}.
 	NoiseKind NoiseKind
@@ -89,8 +100,33 @@ type CountParams struct {
 // This aggregation is not hardened for such applications yet.
 //
 // Count transforms a PrivatePCollection<V> into a PCollection<V, int64>.
+// Since the output is integer-valued, using CountParams.NoiseKind =
+// DiscreteGaussianNoise{} avoids the float rounding step that (continuous)
+// GaussianNoise{} requires.
 func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PCollection {
 	s = s.Scope("pbeam.Count")
+	epsilon, delta, maxPartitionsContributed, noiseKind, countsKV := countsKVPipeline(s, &pcol, params)
+	// Add public partitions and return the aggregation output, if public partitions are specified.
+	if (params.PublicPartitions).IsValid() {
+		return addPublicPartitionsForCount(s, epsilon, delta, maxPartitionsContributed, params, noiseKind, countsKV)
+	}
+	sums := beam.CombinePerKey(s,
+		newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, false),
+		countsKV)
+	// Drop thresholded partitions.
+	counts := beam.ParDo(s, dropThresholdedPartitionsInt64Fn, sums)
+	// Clamp negative counts to zero and return.
+	return beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+}
+
+// countsKVPipeline runs the part of the Count pipeline that is shared by
+// every Count variant: it consumes the privacy budget, validates params,
+// does cross-partition contribution bounding, and returns a
+// PCollection<partition, int64> of the (still un-noised, un-thresholded)
+// per-partition counts, keyed by partition, alongside the parameters needed
+// to noise them. pcol.col is mutated in place if public partitions are
+// used, the same way it is within Count itself.
+func countsKVPipeline(s beam.Scope, pcol *PrivatePCollection, params CountParams) (epsilon, delta float64, maxPartitionsContributed int64, noiseKind noise.Kind, countsKV beam.PCollection) {
 	// Obtain type information from the underlying PCollection<K,V>.
 	idT, partitionT := beam.ValidateKVType(pcol.col)
 
@@ -101,7 +137,6 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 		log.Exitf("Couldn't consume budget: %v", err)
 	}
 
-	var noiseKind noise.Kind
 	if params.NoiseKind == nil {
 		noiseKind = noise.LaplaceNoise
 		log.Infof("No NoiseKind specified, using Laplace Noise by default.")
@@ -113,7 +148,7 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 		log.Exit(err)
 	}
 
-	maxPartitionsContributed := getMaxPartitionsContributed(spec, params.MaxPartitionsContributed)
+	maxPartitionsContributed = getMaxPartitionsContributed(spec, params.MaxPartitionsContributed)
 	// Drop non-public partitions, if public partitions are specified.
 	if (params.PublicPartitions).IsValid() {
 		if partitionT.Type() != params.PublicPartitions.Type().Type() {
@@ -121,7 +156,7 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 				partitionT.Type(), params.PublicPartitions.Type().Type())
 		}
 		partitionEncodedType := beam.EncodedType{partitionT.Type()}
-		pcol.col = dropNonPublicPartitionsVFn(s, params.PublicPartitions, pcol, partitionEncodedType)
+		pcol.col = dropNonPublicPartitionsVFn(s, params.PublicPartitions, *pcol, partitionEncodedType)
 	}
 	// First, encode KV pairs, count how many times each one appears,
 	// and re-key by the original privacy key.
@@ -134,21 +169,11 @@ func Count(s beam.Scope, pcol PrivatePCollection, params CountParams) beam.PColl
 	// Third, now that contribution bounding is done, remove the privacy keys,
 	// decode the value, and sum all the counts bounded by maxCountContrib.
 	countPairs := beam.DropKey(s, rekeyed)
-	countsKV := beam.ParDo(s,
+	countsKV = beam.ParDo(s,
 		newDecodePairInt64Fn(partitionT.Type()),
 		countPairs,
 		beam.TypeDefinition{Var: beam.XType, T: partitionT.Type()})
-	// Add public partitions and return the aggregation output, if public partitions are specified.
-	if (params.PublicPartitions).IsValid() {
-		return addPublicPartitionsForCount(s, epsilon, delta, maxPartitionsContributed, params, noiseKind, countsKV)
-	}
-	sums := beam.CombinePerKey(s,
-		newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, false),
-		countsKV)
-	// Drop thresholded partitions.
-	counts := beam.ParDo(s, dropThresholdedPartitionsInt64Fn, sums)
-	// Clamp negative counts to zero and return.
-	return beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+	return epsilon, delta, maxPartitionsContributed, noiseKind, countsKV
 }
 
 func checkCountParams(params CountParams, epsilon, delta float64, noiseKind noise.Kind) error {
@@ -159,6 +184,9 @@ func checkCountParams(params CountParams, epsilon, delta float64, noiseKind nois
 	if (params.PublicPartitions).IsValid() && noiseKind == noise.LaplaceNoise {
 		err = checks.CheckNoDelta("pbeam.Count", delta)
 	} else {
+		// Both (continuous) Gaussian and discrete Gaussian noise need a
+		// strictly positive delta to calibrate their standard deviation,
+		// with or without public partitions.
 		err = checks.CheckDeltaStrict("pbeam.Count", delta)
 	}
 	if err != nil {
@@ -186,3 +214,430 @@ func addPublicPartitionsForCount(s beam.Scope, epsilon, delta float64, maxPartit
 	// Clamp negative counts to zero and return.
 	return beam.ParDo(s, clampNegativePartitionsInt64Fn, finalPartitions)
 }
+
+// StreamingCountParams specifies the parameters associated with a
+// StreamingCount aggregation over a windowed PrivatePCollection.
+type StreamingCountParams struct {
+	CountParams
+	// The maximum number of distinct windows that a given privacy identifier
+	// can contribute to. Privacy identifiers contributing to more windows
+	// than this will have their excess window contributions dropped at
+	// random, the same way MaxPartitionsContributed bounds the number of
+	// distinct partitions a privacy identifier can contribute to within a
+	// window.
+	//
+	// Required.
+	MaxWindowsContributed int64
+	// The windowing strategy pcol's PCollection was windowed into upstream
+	// (e.g. window.NewFixedWindows(...)). StreamingCount needs to know it
+	// in order to restore it after briefly moving into the global window to
+	// bound contributions across windows; see boundContributionsAcrossWindows.
+	//
+	// Required.
+	Window window.Fn
+	// A data-independent upper bound on the number of windows this
+	// StreamingCount's PrivatePCollection will ever be split into (e.g. the
+	// number of fixed windows in the pipeline's maximum processing
+	// duration). StreamingCount uses it to check, once, at pipeline
+	// construction time, that spending its per-window budget on every one
+	// of those windows cannot exceed spec's global cap; see
+	// StreamingPrivacySpec.
+	//
+	// Required.
+	MaxWindows int64
+}
+
+// StreamingCount is the windowed counterpart of Count. It aggregates a
+// windowed PrivatePCollection, emitting a noisy count for every
+// (partition, window) pair it sees.
+//
+// Unlike Count, which consumes its (epsilon, delta) budget once from
+// PrivacySpec for the whole PrivatePCollection, StreamingCount consumes a
+// slice of spec's budget for every one of up to MaxWindows windows. Since a
+// Beam pipeline's workers have no shared runtime counter to track spend
+// window by window, spec checks once, at construction time, via advanced
+// composition, that spending this per-window slice on every one of
+// MaxWindows windows cannot exceed its global (epsilon, delta) cap; see
+// StreamingPrivacySpec. This is the pan-privacy model: a privacy
+// identifier's contributions are bounded within each window by
+// CountParams.MaxPartitionsContributed as usual, and additionally bounded
+// across windows by StreamingCountParams.MaxWindowsContributed.
+//
+// StreamingCount transforms a windowed PrivatePCollection<V> into a
+// PCollection<V, int64> keyed by (partition, window).
+func StreamingCount(s beam.Scope, pcol PrivatePCollection, spec *StreamingPrivacySpec, params StreamingCountParams) beam.PCollection {
+	s = s.Scope("pbeam.StreamingCount")
+	idT, partitionT := beam.ValidateKVType(pcol.col)
+
+	if params.MaxWindows <= 0 {
+		log.Exitf("pbeam.StreamingCount: MaxWindows should be strictly positive, got %d", params.MaxWindows)
+	}
+	epsilon, delta, err := spec.consumeWindowBudget(params.Epsilon, params.Delta, params.MaxWindows)
+	if err != nil {
+		log.Exitf("Couldn't consume per-window budget: %v", err)
+	}
+
+	var noiseKind noise.Kind
+	if params.NoiseKind == nil {
+		noiseKind = noise.LaplaceNoise
+		log.Infof("No NoiseKind specified, using Laplace Noise by default.")
+	} else {
+		noiseKind = params.NoiseKind.toNoiseKind()
+	}
+	err = checkCountParams(params.CountParams, epsilon, delta, noiseKind)
+	if err != nil {
+		log.Exit(err)
+	}
+	if params.MaxWindowsContributed <= 0 {
+		log.Exitf("pbeam.StreamingCount: MaxWindowsContributed should be strictly positive, got %d", params.MaxWindowsContributed)
+	}
+	if params.Window == nil {
+		log.Exit("pbeam.StreamingCount: Window must be set to the windowing strategy pcol was windowed into")
+	}
+
+	maxPartitionsContributed := getMaxPartitionsContributed(pcol.privacySpec, params.MaxPartitionsContributed)
+	// Drop non-public partitions, if public partitions are specified.
+	if (params.PublicPartitions).IsValid() {
+		if partitionT.Type() != params.PublicPartitions.Type().Type() {
+			log.Exitf("Public partitions must be of type %v. Got type %v instead.",
+				partitionT.Type(), params.PublicPartitions.Type().Type())
+		}
+		partitionEncodedType := beam.EncodedType{partitionT.Type()}
+		pcol.col = dropNonPublicPartitionsVFn(s, params.PublicPartitions, pcol, partitionEncodedType)
+	}
+	// Encode KV pairs, count how many times each one appears within its
+	// window, and re-key by the original privacy key.
+	coded := beam.ParDo(s, kv.NewEncodeFn(idT, partitionT), pcol.col)
+	kvCounts := stats.Count(s, coded)
+	counts64 := beam.ParDo(s, vToInt64Fn, kvCounts)
+	rekeyed := beam.ParDo(s, rekeyInt64Fn, counts64)
+	// Bound the number of distinct windows a privacy identifier can
+	// contribute to, then bound the number of distinct partitions it can
+	// contribute to within each remaining window.
+	rekeyed = boundContributionsAcrossWindows(s, rekeyed, idT.Type(), params.MaxWindowsContributed, params.Window)
+	rekeyed = boundContributions(s, rekeyed, maxPartitionsContributed)
+	// Remove the privacy keys, decode the value, and sum all the counts
+	// bounded by MaxValue, independently per window.
+	countPairs := beam.DropKey(s, rekeyed)
+	countsKV := beam.ParDo(s,
+		newDecodePairInt64Fn(partitionT.Type()),
+		countPairs,
+		beam.TypeDefinition{Var: beam.XType, T: partitionT.Type()})
+	if (params.PublicPartitions).IsValid() {
+		return addPublicPartitionsForCount(s, epsilon, delta, maxPartitionsContributed, params.CountParams, noiseKind, countsKV)
+	}
+	sums := beam.CombinePerKey(s,
+		newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, false),
+		countsKV)
+	counts := beam.ParDo(s, dropThresholdedPartitionsInt64Fn, sums)
+	return beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+}
+
+// idWindowKey identifies a single (privacy identifier, window) combination
+// once both have been encoded to bytes, so it can be used as an ordinary,
+// coder-able Beam key after a move into the global window.
+type idWindowKey struct {
+	ID     []byte
+	Window []byte
+}
+
+// windowGroup carries every value a single privacy identifier contributed
+// to a single window, still individually byte-encoded.
+type windowGroup struct {
+	Window []byte
+	Values [][]byte
+}
+
+// tagWindowFn re-keys each (id, value) pair by (id, window), byte-encoding
+// both the id and the window so that the result is an ordinary, coder-able
+// Beam KV. Once boundContributionsAcrossWindows has moved that result into
+// the global window, a privacy identifier's contributions to every window it touched are
+// visible to a single GroupByKey, rather than being kept apart the way
+// Beam normally keeps windows' contents apart.
+type tagWindowFn struct {
+	IDType    beam.EncodedType
+	ValueType beam.EncodedType
+}
+
+func newTagWindowFn(idType, valueType reflect.Type) *tagWindowFn {
+	return &tagWindowFn{IDType: beam.EncodedType{T: idType}, ValueType: beam.EncodedType{T: valueType}}
+}
+
+func (fn *tagWindowFn) ProcessElement(w beam.Window, id beam.X, value beam.X) (idWindowKey, []byte, error) {
+	encodedID, err := encodeValue(fn.IDType.T, id)
+	if err != nil {
+		return idWindowKey{}, nil, err
+	}
+	encodedWindow, err := encodeValue(reflect.TypeOf(w.Start()), w.Start())
+	if err != nil {
+		return idWindowKey{}, nil, err
+	}
+	encodedValue, err := encodeValue(fn.ValueType.T, value)
+	if err != nil {
+		return idWindowKey{}, nil, err
+	}
+	return idWindowKey{ID: encodedID, Window: encodedWindow}, encodedValue, nil
+}
+
+// groupByWindowFn collects a single (id, window) group's values (which
+// GroupByKey has brought together) into one windowGroup element, and
+// re-keys the result by id alone: at this point, each emitted element
+// corresponds to exactly one of the distinct windows a given id
+// contributed to, so bounding the number of such elements per id -- which
+// is exactly what boundContributions does -- bounds the number of distinct
+// windows per id.
+type groupByWindowFn struct {
+	IDType beam.EncodedType
+}
+
+func newGroupByWindowFn(idType reflect.Type) *groupByWindowFn {
+	return &groupByWindowFn{IDType: beam.EncodedType{T: idType}}
+}
+
+func (fn *groupByWindowFn) ProcessElement(key idWindowKey, values func(*[]byte) bool, emit func(beam.X, windowGroup)) error {
+	id, err := decodeValue(fn.IDType.T, key.ID)
+	if err != nil {
+		return err
+	}
+	var collected [][]byte
+	var v []byte
+	for values(&v) {
+		collected = append(collected, v)
+	}
+	emit(id, windowGroup{Window: key.Window, Values: collected})
+	return nil
+}
+
+// untagWindowGroupFn re-emits every value collected in a surviving
+// windowGroup as its own (id, value) element, decoding the value back to
+// its original type. It runs after boundContributionsAcrossWindows has
+// moved the windowGroups back into windowFn, the windowing strategy they
+// originally arrived in.
+type untagWindowGroupFn struct {
+	ValueType beam.EncodedType
+}
+
+func newUntagWindowGroupFn(valueType reflect.Type) *untagWindowGroupFn {
+	return &untagWindowGroupFn{ValueType: beam.EncodedType{T: valueType}}
+}
+
+func (fn *untagWindowGroupFn) ProcessElement(id beam.X, group windowGroup, emit func(beam.X, beam.X)) error {
+	for _, encoded := range group.Values {
+		value, err := decodeValue(fn.ValueType.T, encoded)
+		if err != nil {
+			return err
+		}
+		emit(id, value)
+	}
+	return nil
+}
+
+// boundContributionsAcrossWindows bounds, for each privacy identifier, the
+// number of distinct windows it is allowed to contribute to: rekeyed is a
+// PCollection<id, V> in which Beam keeps each window's elements in a
+// separate per-window group, so a privacy identifier contributing to
+// several windows shows up in several such groups. This re-keys every
+// element by (id, window) and moves everything into the global window, so
+// that a single identifier's contributions across all windows are visible
+// together; collects each (id, window) group into one element per distinct
+// window; reuses boundContributions -- which, keyed by id, bounds the
+// number of distinct *windows* here rather than the number of distinct
+// *partitions* it normally bounds within Count -- to randomly drop a
+// privacy identifier's contributions to any windows beyond the first
+// maxWindowsContributed; and finally un-collects the survivors and moves
+// them back into windowFn, the original windowing strategy.
+func boundContributionsAcrossWindows(s beam.Scope, rekeyed beam.PCollection, idType reflect.Type, maxWindowsContributed int64, windowFn window.Fn) beam.PCollection {
+	_, valueT := beam.ValidateKVType(rekeyed)
+	tagged := beam.ParDo(s, newTagWindowFn(idType, valueT.Type()), rekeyed)
+	global := beam.WindowInto(s, window.NewGlobalWindows(), tagged)
+	grouped := beam.GroupByKey(s, global)
+	byID := beam.ParDo(s, newGroupByWindowFn(idType), grouped,
+		beam.TypeDefinition{Var: beam.XType, T: idType})
+	bounded := boundContributions(s, byID, maxWindowsContributed)
+	rewindowed := beam.WindowInto(s, windowFn, bounded)
+	return beam.ParDo(s, newUntagWindowGroupFn(valueT.Type()), rewindowed,
+		beam.TypeDefinition{Var: beam.XType, T: valueT.Type()})
+}
+
+// encodeValue and decodeValue generically (de)serialize a value of an
+// otherwise unknown (beam.X) type, so that it can be carried through steps,
+// like boundContributionsAcrossWindows' move into the global window, that
+// require a concrete, coder-able Go type.
+func encodeValue(t reflect.Type, value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(reflect.ValueOf(value)); err != nil {
+		return nil, fmt.Errorf("couldn't encode value of type %v: %v", t, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeValue(t reflect.Type, encoded []byte) (interface{}, error) {
+	v := reflect.New(t)
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).DecodeValue(v.Elem()); err != nil {
+		return nil, fmt.Errorf("couldn't decode value of type %v: %v", t, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+// topKEntryInt64 is one candidate in a top-K selection: a partition, still
+// byte-encoded so it can travel through a CombineFn's accumulator, and the
+// (possibly noised) value it is being ranked by.
+type topKEntryInt64 struct {
+	Partition []byte
+	Value     int64
+}
+
+// topKAccumInt64 is selectTopKInt64Fn's accumulator: the best (at most K)
+// entries seen so far, kept sorted in descending order by Value.
+type topKAccumInt64 struct {
+	K       int64
+	Entries []topKEntryInt64
+}
+
+// insertTopKEntry inserts entry into entries, keeping entries sorted in
+// descending order by Value and truncated to at most k elements.
+func insertTopKEntry(entries []topKEntryInt64, entry topKEntryInt64, k int64) []topKEntryInt64 {
+	return mergeTopKEntries(entries, []topKEntryInt64{entry}, k)
+}
+
+// mergeTopKEntries merges a and b, keeping at most the k largest entries by
+// Value.
+func mergeTopKEntries(a, b []topKEntryInt64, k int64) []topKEntryInt64 {
+	merged := append(append([]topKEntryInt64{}, a...), b...)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Value > merged[j].Value })
+	if int64(len(merged)) > k {
+		merged = merged[:k]
+	}
+	return merged
+}
+
+// selectTopKInt64Fn is a beam.CombineFn that keeps the K largest values
+// among its inputs, without adding any noise of its own. It backs
+// topInt64sByValue: the values it ranks by have already been noised (and,
+// when the set of partitions isn't public, already passed partition
+// selection) by a preceding CombinePerKey, so keeping the K largest is
+// valid post-processing and spends no additional privacy budget.
+type selectTopKInt64Fn struct {
+	K             int64
+	PartitionType beam.EncodedType
+}
+
+func newSelectTopKInt64Fn(k int64, partitionType reflect.Type) *selectTopKInt64Fn {
+	return &selectTopKInt64Fn{K: k, PartitionType: beam.EncodedType{T: partitionType}}
+}
+
+func (fn *selectTopKInt64Fn) CreateAccumulator() topKAccumInt64 {
+	return topKAccumInt64{K: fn.K}
+}
+
+func (fn *selectTopKInt64Fn) AddInput(accum topKAccumInt64, partition beam.X, value int64) (topKAccumInt64, error) {
+	encoded, err := encodeValue(fn.PartitionType.T, partition)
+	if err != nil {
+		return accum, err
+	}
+	accum.Entries = insertTopKEntry(accum.Entries, topKEntryInt64{Partition: encoded, Value: value}, fn.K)
+	return accum, nil
+}
+
+func (fn *selectTopKInt64Fn) MergeAccumulators(a, b topKAccumInt64) topKAccumInt64 {
+	return topKAccumInt64{K: fn.K, Entries: mergeTopKEntries(a.Entries, b.Entries, fn.K)}
+}
+
+func (fn *selectTopKInt64Fn) ExtractOutput(accum topKAccumInt64) topKAccumInt64 {
+	return accum
+}
+
+// flattenTopKFn re-emits a topKAccumInt64's (at most K) entries as
+// individual (partition, value) elements, decoding each partition back to
+// its original type. It turns the single combined element a CombineGlobally
+// produces back into the PCollection<V, int64> of up to K elements that
+// CountTopK promises.
+type flattenTopKFn struct {
+	PartitionType beam.EncodedType
+}
+
+func newFlattenTopKFn(partitionType reflect.Type) *flattenTopKFn {
+	return &flattenTopKFn{PartitionType: beam.EncodedType{T: partitionType}}
+}
+
+func (fn *flattenTopKFn) ProcessElement(accum topKAccumInt64, emit func(beam.X, int64)) error {
+	for _, entry := range accum.Entries {
+		partition, err := decodeValue(fn.PartitionType.T, entry.Partition)
+		if err != nil {
+			return err
+		}
+		emit(partition, entry.Value)
+	}
+	return nil
+}
+
+// topInt64sByValue selects the K elements of noised, a PCollection<V,
+// int64> whose values are already differentially private, with the largest
+// values. Since noised is already (epsilon, delta)-DP, this selection is
+// post-processing and spends no further privacy budget.
+func topInt64sByValue(s beam.Scope, noised beam.PCollection, k int64) beam.PCollection {
+	_, partitionT := beam.ValidateKVType(noised)
+	combined := beam.CombineGlobally(s, newSelectTopKInt64Fn(k, partitionT.Type()), noised)
+	return beam.ParDo(s, newFlattenTopKFn(partitionT.Type()), combined,
+		beam.TypeDefinition{Var: beam.XType, T: partitionT.Type()})
+}
+
+// CountTopKParams specifies the parameters associated with a CountTopK
+// aggregation.
+type CountTopKParams struct {
+	CountParams
+	// The number of partitions to release. Only the K partitions with the
+	// largest noisy counts are released.
+	//
+	// Required.
+	TopK int64
+}
+
+// CountTopK is a variant of Count for use cases with a very large number of
+// partitions (e.g. "top hashtags" or "top URLs") where materializing a noisy
+// count for every partition would be wasteful. It runs the same per-partition
+// sum, noise and thresholding pipeline as Count, then, instead of returning
+// every surviving partition, keeps only the TopK with the largest noisy
+// counts. Since thresholding has already made the set of surviving
+// partitions (epsilon, delta)-differentially private, and every count in it
+// has already been noised, keeping the K largest of them is valid
+// post-processing: it spends no further privacy budget and needs no
+// separate selection mechanism of its own.
+//
+// If PublicPartitions is set, the set of partitions is already public, so
+// there's nothing to threshold: CountTopK noises every public partition's
+// sum as usual and keeps the K largest.
+//
+// CountTopK transforms a PrivatePCollection<V> into a PCollection<V, int64>
+// containing at most TopK elements.
+func CountTopK(s beam.Scope, pcol PrivatePCollection, params CountTopKParams) beam.PCollection {
+	s = s.Scope("pbeam.CountTopK")
+	if params.TopK <= 0 {
+		log.Exitf("pbeam.CountTopK: TopK should be strictly positive, got %d", params.TopK)
+	}
+	epsilon, delta, maxPartitionsContributed, noiseKind, countsKV := countsKVPipeline(s, &pcol, params.CountParams)
+	if (params.PublicPartitions).IsValid() {
+		// The set of partitions is already public, so there's no thresholding
+		// step: noise every public partition's sum as usual, then keep the K
+		// largest.
+		sums := beam.CombinePerKey(s,
+			newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, true),
+			beam.Flatten(s, beam.ParDo(s, addDummyValuesToPublicPartitionsInt64Fn, params.PublicPartitions), countsKV))
+		noised := beam.ParDo(s, dereferenceValueToInt64, sums)
+		noised = beam.ParDo(s, clampNegativePartitionsInt64Fn, noised)
+		return topInt64sByValue(s, noised, params.TopK)
+	}
+	// Without public partitions, reuse Count's own sum-noise-threshold
+	// pipeline: CombinePerKey sums and noises every partition exactly once
+	// (not once per contributing privacy identifier), and
+	// dropThresholdedPartitionsInt64Fn drops the partitions that survive
+	// only because of noise. Only once that selection has happened is the
+	// set of candidate partitions itself differentially private, so it's
+	// then safe to non-privately keep the K with the largest counts.
+	sums := beam.CombinePerKey(s,
+		newBoundedSumInt64Fn(epsilon, delta, maxPartitionsContributed, 0, params.MaxValue, noiseKind, false),
+		countsKV)
+	counts := beam.ParDo(s, dropThresholdedPartitionsInt64Fn, sums)
+	counts = beam.ParDo(s, clampNegativePartitionsInt64Fn, counts)
+	return topInt64sByValue(s, counts, params.TopK)
+}
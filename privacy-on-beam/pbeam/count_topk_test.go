@@ -0,0 +1,84 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSelectTopKInt64FnPerPartition checks selectTopKInt64Fn with K=1 on
+// one already-summed value per partition, the way CountTopK feeds it:
+// partition "a" with value 1000 and partition "b" with value 500 must keep
+// only "a". selectTopKInt64Fn ranks each AddInput call on its own and does
+// not sum inputs that share a partition key; that summing happens upstream,
+// in CombinePerKey.
+func TestSelectTopKInt64FnPerPartition(t *testing.T) {
+	fn := newSelectTopKInt64Fn(1, reflect.TypeOf(""))
+	accum := fn.CreateAccumulator()
+	var err error
+	// A value of 1000 standing in for a partition whose per-partition sum
+	// has already been computed upstream, the way CombinePerKey -> CountTopK
+	// calls this combiner.
+	accum, err = fn.AddInput(accum, "a", 1000)
+	if err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	accum, err = fn.AddInput(accum, "b", 500)
+	if err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	out := fn.ExtractOutput(accum)
+	if len(out.Entries) != 1 {
+		t.Fatalf("ExtractOutput: got %d entries, want 1", len(out.Entries))
+	}
+	if out.Entries[0].Value != 1000 {
+		t.Errorf("ExtractOutput: got top entry value %d, want 1000 (partition \"a\")", out.Entries[0].Value)
+	}
+}
+
+// TestMergeTopKEntries checks that merging two accumulators' entries keeps
+// the K largest values across both, as CombineFn.MergeAccumulators relies
+// on when Beam merges partial combines from different workers.
+func TestMergeTopKEntries(t *testing.T) {
+	a := []topKEntryInt64{{Partition: []byte("x"), Value: 5}, {Partition: []byte("y"), Value: 1}}
+	b := []topKEntryInt64{{Partition: []byte("z"), Value: 10}, {Partition: []byte("w"), Value: 3}}
+
+	merged := mergeTopKEntries(a, b, 2)
+	if len(merged) != 2 {
+		t.Fatalf("mergeTopKEntries: got %d entries, want 2", len(merged))
+	}
+	if string(merged[0].Partition) != "z" || merged[0].Value != 10 {
+		t.Errorf("mergeTopKEntries: got top entry %+v, want partition z value 10", merged[0])
+	}
+	if string(merged[1].Partition) != "x" || merged[1].Value != 5 {
+		t.Errorf("mergeTopKEntries: got second entry %+v, want partition x value 5", merged[1])
+	}
+}
+
+// TestInsertTopKEntryTruncates checks that inserting into an already-full
+// set of k entries drops the smallest value rather than growing past k.
+func TestInsertTopKEntryTruncates(t *testing.T) {
+	entries := []topKEntryInt64{{Partition: []byte("a"), Value: 10}, {Partition: []byte("b"), Value: 5}}
+	entries = insertTopKEntry(entries, topKEntryInt64{Partition: []byte("c"), Value: 7}, 2)
+	if len(entries) != 2 {
+		t.Fatalf("insertTopKEntry: got %d entries, want 2", len(entries))
+	}
+	if string(entries[0].Partition) != "a" || string(entries[1].Partition) != "c" {
+		t.Errorf("insertTopKEntry: got partitions [%s, %s], want [a, c] (b's value 5 should have been dropped)", entries[0].Partition, entries[1].Partition)
+	}
+}
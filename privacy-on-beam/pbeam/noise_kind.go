@@ -0,0 +1,51 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import "github.com/google/differential-privacy/go/noise"
+
+// NoiseKind is the interface implemented by the noise types accepted by the
+// NoiseKind field of aggregation params (e.g. CountParams.NoiseKind).
+type NoiseKind interface {
+	toNoiseKind() noise.Kind
+}
+
+// LaplaceNoise is a NoiseKind that makes an aggregation use Laplace noise.
+type LaplaceNoise struct{}
+
+func (LaplaceNoise) toNoiseKind() noise.Kind {
+	return noise.LaplaceNoise
+}
+
+// GaussianNoise is a NoiseKind that makes an aggregation use (continuous)
+// Gaussian noise.
+type GaussianNoise struct{}
+
+func (GaussianNoise) toNoiseKind() noise.Kind {
+	return noise.GaussianNoise
+}
+
+// DiscreteGaussianNoise is a NoiseKind that makes an aggregation use
+// discrete Gaussian noise: noise sampled on the integers rather than on the
+// reals, so that integer-valued aggregations (such as Count) don't need a
+// float rounding step. See noise.DiscreteGaussian for the rejection sampler
+// and the (epsilon, delta) to sigma calibration.
+type DiscreteGaussianNoise struct{}
+
+func (DiscreteGaussianNoise) toNoiseKind() noise.Kind {
+	return noise.DiscreteGaussianNoise
+}
@@ -0,0 +1,129 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/golang/glog"
+)
+
+// StreamingPrivacySpec bounds the differential privacy budget spent across
+// the many windows of a windowed PrivatePCollection. Unlike PrivacySpec,
+// which hands out its entire (epsilon, delta) budget once per aggregation,
+// StreamingPrivacySpec hands out a slice of that budget to every window an
+// aggregation such as StreamingCount processes.
+//
+// Beam pipelines are distributed: the workers that process each window have
+// no shared, consistent runtime counter they could use to track cumulative
+// spend window by window the way PrivacySpec.consumeBudget tracks a single
+// aggregation's spend. So instead of tracking spend at runtime,
+// StreamingPrivacySpec requires a data-independent upper bound on the
+// number of windows a pipeline will ever produce (e.g. the number of fixed
+// windows in the pipeline's maximum processing duration) and, at pipeline
+// construction time, checks once -- via the advanced composition theorem --
+// that spending the per-window budget on every one of those windows cannot
+// exceed the spec's global cap. This is necessarily more conservative than a
+// true runtime accountant would be, since it must assume the worst case
+// (every possible window gets used), but it is the bound a distributed
+// pipeline can actually enforce.
+//
+// StreamingPrivacySpec records no spend: each consumeWindowBudget call is
+// checked against the whole (TotalEpsilon, TotalDelta) cap on its own, so
+// the costs of several aggregations passed the same spec are not added up.
+type StreamingPrivacySpec struct {
+	// TotalEpsilon, TotalDelta is the global (epsilon, delta) budget that a
+	// single aggregation's spend, summed by advanced composition across
+	// every one of its maxWindows windows, must not exceed.
+	TotalEpsilon, TotalDelta float64
+	// DeltaSlack is the portion of TotalDelta reserved for the advanced
+	// composition theorem's own failure probability, rather than for the
+	// per-window mechanisms themselves. Must be strictly between 0 and
+	// TotalDelta.
+	DeltaSlack float64
+}
+
+// NewStreamingPrivacySpec returns a StreamingPrivacySpec enforcing a global
+// (totalEpsilon, totalDelta) budget across however many windows the
+// pipelines sharing it end up processing, reserving deltaSlack of
+// totalDelta for the advanced composition theorem's failure probability.
+func NewStreamingPrivacySpec(totalEpsilon, totalDelta, deltaSlack float64) *StreamingPrivacySpec {
+	if totalEpsilon <= 0 {
+		log.Exitf("pbeam.NewStreamingPrivacySpec: TotalEpsilon should be strictly positive, got %f", totalEpsilon)
+	}
+	if deltaSlack <= 0 || deltaSlack >= totalDelta {
+		log.Exitf("pbeam.NewStreamingPrivacySpec: DeltaSlack should be strictly between 0 and TotalDelta, got DeltaSlack=%f TotalDelta=%f", deltaSlack, totalDelta)
+	}
+	return &StreamingPrivacySpec{TotalEpsilon: totalEpsilon, TotalDelta: totalDelta, DeltaSlack: deltaSlack}
+}
+
+// defaultWindowBudgetFraction is the fraction of TotalEpsilon (and of
+// TotalDelta minus DeltaSlack) handed out to a window when the caller
+// doesn't pin down an explicit per-window epsilon (or delta). It only affects how an unspecified
+// budget is split across windows; consumeWindowBudget's advanced
+// composition check is always computed against maxWindows, so a pipeline
+// that ends up producing fewer windows than maxWindows simply underspends
+// its budget, rather than the bound silently being wrong.
+const defaultWindowBudgetFraction = 0.001
+
+// consumeWindowBudget returns the (epsilon, delta) to spend on every one of
+// maxWindows windows: the caller-supplied epsilon and delta, where each one
+// that is zero is replaced, independently of the other, by a
+// defaultWindowBudgetFraction slice of TotalEpsilon or of
+// TotalDelta-DeltaSlack respectively. maxWindows must be a data-independent upper bound on the number
+// of windows the pipeline can ever produce; see StreamingPrivacySpec.
+// consumeWindowBudget checks, via advanced composition over all maxWindows
+// windows, whether spending that amount on every one of them would push the
+// cumulative (epsilon, delta) cost beyond (TotalEpsilon, TotalDelta), and
+// returns an error instead of spending it if so.
+func (sp *StreamingPrivacySpec) consumeWindowBudget(epsilon, delta float64, maxWindows int64) (float64, float64, error) {
+	if maxWindows <= 0 {
+		return 0, 0, fmt.Errorf("pbeam.StreamingPrivacySpec: maxWindows should be strictly positive, got %d", maxWindows)
+	}
+	if epsilon == 0 {
+		epsilon = sp.TotalEpsilon * defaultWindowBudgetFraction
+	}
+	if delta == 0 {
+		delta = (sp.TotalDelta - sp.DeltaSlack) * defaultWindowBudgetFraction
+	}
+
+	cumulativeEpsilon, cumulativeDelta := advancedComposition(epsilon, delta, maxWindows, sp.DeltaSlack)
+	if cumulativeEpsilon > sp.TotalEpsilon || cumulativeDelta > sp.TotalDelta {
+		return 0, 0, fmt.Errorf(
+			"pbeam.StreamingPrivacySpec: spending (epsilon=%f, delta=%f) on each of maxWindows=%d windows would cost (epsilon=%f, delta=%f) cumulatively, exceeding the global budget (epsilon=%f, delta=%f)",
+			epsilon, delta, maxWindows, cumulativeEpsilon, cumulativeDelta, sp.TotalEpsilon, sp.TotalDelta)
+	}
+	return epsilon, delta, nil
+}
+
+// advancedComposition returns the cumulative (epsilon, delta) spent by n
+// independently run (epsilon, delta)-differentially private mechanisms,
+// using the advanced composition theorem (Dwork, Rothblum & Vadhan, 2010,
+// "Boosting and Differential Privacy", Theorem III.3): for any
+// deltaSlack in (0, 1), the composition of n (epsilon, delta)-DP
+// mechanisms is
+//
+//	(epsilon*sqrt(2*n*ln(1/deltaSlack)) + n*epsilon*(exp(epsilon)-1), n*delta+deltaSlack)
+//
+// differentially private.
+func advancedComposition(epsilon, delta float64, n int64, deltaSlack float64) (float64, float64) {
+	nf := float64(n)
+	cumulativeEpsilon := epsilon*math.Sqrt(2*nf*math.Log(1/deltaSlack)) + nf*epsilon*(math.Exp(epsilon)-1)
+	cumulativeDelta := nf*delta + deltaSlack
+	return cumulativeEpsilon, cumulativeDelta
+}
@@ -0,0 +1,60 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pbeam
+
+import "testing"
+
+func TestConsumeWindowBudget(t *testing.T) {
+	spec := NewStreamingPrivacySpec(1, 1e-5, 1e-6)
+
+	if _, _, err := spec.consumeWindowBudget(0.01, 1e-7, 10); err != nil {
+		t.Errorf("consumeWindowBudget(0.01, 1e-7, 10) returned an error for a budget that fits: %v", err)
+	}
+}
+
+func TestConsumeWindowBudgetExhaustion(t *testing.T) {
+	spec := NewStreamingPrivacySpec(1, 1e-5, 1e-6)
+
+	// Spending a sizeable per-window epsilon over a huge number of windows
+	// must eventually exceed the global budget.
+	if _, _, err := spec.consumeWindowBudget(0.1, 1e-7, 1e6); err == nil {
+		t.Error("consumeWindowBudget(0.1, 1e-7, 1e6) returned no error, want one since the cumulative cost exceeds TotalEpsilon")
+	}
+}
+
+func TestConsumeWindowBudgetRequiresPositiveMaxWindows(t *testing.T) {
+	spec := NewStreamingPrivacySpec(1, 1e-5, 1e-6)
+
+	if _, _, err := spec.consumeWindowBudget(0.01, 1e-7, 0); err == nil {
+		t.Error("consumeWindowBudget with maxWindows=0 returned no error, want one")
+	}
+}
+
+func TestConsumeWindowBudgetDefaultsAreWithinTotal(t *testing.T) {
+	spec := NewStreamingPrivacySpec(1, 1e-5, 1e-6)
+
+	epsilon, delta, err := spec.consumeWindowBudget(0, 0, 5)
+	if err != nil {
+		t.Fatalf("consumeWindowBudget(0, 0, 5): %v", err)
+	}
+	if epsilon <= 0 || epsilon >= spec.TotalEpsilon {
+		t.Errorf("consumeWindowBudget(0, 0, 5) epsilon = %f, want strictly between 0 and TotalEpsilon=%f", epsilon, spec.TotalEpsilon)
+	}
+	if delta <= 0 || delta >= spec.TotalDelta {
+		t.Errorf("consumeWindowBudget(0, 0, 5) delta = %f, want strictly between 0 and TotalDelta=%f", delta, spec.TotalDelta)
+	}
+}